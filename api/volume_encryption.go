@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rancher/go-rancher/api"
+
+	"github.com/rancher/longhorn-manager/csi"
+	"github.com/rancher/longhorn-manager/pkg/kms"
+)
+
+// RotateEncryptionKeyInput is the body accepted by the rotateEncryptionKey
+// volume action. It is currently empty, but kept as a named type so
+// additional options (e.g. forcing rotation on a detached volume) can be
+// added without breaking the schema.
+type RotateEncryptionKeyInput struct {
+}
+
+// VolumeRotateEncryptionKey handles
+// POST /v1/volumes/{name}?action=rotateEncryptionKey.
+//
+// It unwraps the volume's current DEK, generates a new one, adds it to the
+// LUKS2 keyslots of the active device (if the volume is currently attached),
+// removes the old passphrase, and persists the newly wrapped DEK on the
+// volume CR.
+func (s *Server) VolumeRotateEncryptionKey(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	var input RotateEncryptionKeyInput
+	if err := json.NewDecoder(req.Body).Decode(&input); err != nil && err.Error() != "EOF" {
+		return fmt.Errorf("failed to decode %s action input: %v", "rotateEncryptionKey", err)
+	}
+
+	volume, err := s.man.GetVolume(name)
+	if err != nil {
+		return fmt.Errorf("failed to get volume %s: %v", name, err)
+	}
+	if !volume.Encrypted {
+		return fmt.Errorf("volume %s is not encrypted", name)
+	}
+
+	provider, err := kms.New(kms.Config{Provider: volume.KMSProvider, ConfigRef: volume.KMSConfigRef})
+	if err != nil {
+		return fmt.Errorf("failed to initialize kms provider for volume %s: %v", name, err)
+	}
+
+	newWrappedDEK, err := csi.RotateEncryptionKey(provider, name, volume.WrappedDEK)
+	if err != nil {
+		return fmt.Errorf("failed to rotate encryption key for volume %s: %v", name, err)
+	}
+
+	volume.WrappedDEK = newWrappedDEK
+	updated, err := s.man.UpdateVolume(volume)
+	if err != nil {
+		return fmt.Errorf("failed to persist rotated encryption key for volume %s: %v", name, err)
+	}
+
+	apiContext.Write(toVolumeResource(updated))
+	return nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// nodeServiceCapabilities is advertised by NodeGetCapabilities. Only
+// EXPAND_VOLUME is listed: NodeStageVolume/NodeUnstageVolume are not
+// implemented by this driver, and advertising STAGE_UNSTAGE_VOLUME without
+// them would make the external CSI sidecar call RPCs that return
+// Unimplemented on every mount.
+var nodeServiceCapabilities = []*csi.NodeServiceCapability{
+	newNodeServiceCapability(csi.NodeServiceCapability_RPC_EXPAND_VOLUME),
+}
+
+func newNodeServiceCapability(cap csi.NodeServiceCapability_RPC_Type) *csi.NodeServiceCapability {
+	return &csi.NodeServiceCapability{
+		Type: &csi.NodeServiceCapability_Rpc{
+			Rpc: &csi.NodeServiceCapability_RPC{
+				Type: cap,
+			},
+		},
+	}
+}
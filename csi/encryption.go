@@ -0,0 +1,298 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"k8s.io/utils/exec"
+
+	"github.com/rancher/longhorn-manager/pkg/kms"
+)
+
+// dekSize is the length, in bytes, of the data encryption key Longhorn
+// generates for a new encrypted volume before it is wrapped by the KMS and
+// handed to cryptsetup as the LUKS2 passphrase.
+const dekSize = 32
+
+// encryptionStateDir holds one JSON file per encrypted volume, recording the
+// mapper name cryptsetup opened the volume under so NodeUnpublishVolume can
+// find and close it without re-deriving the device path. It is a var, not a
+// const, so tests can point it at a t.TempDir() instead of the real host
+// path.
+var encryptionStateDir = "/var/lib/longhorn/encryption"
+
+// encryptionState is persisted alongside the iSCSI disk state so that
+// NodeUnpublishVolume and the rotateEncryptionKey action know which mapper
+// device backs a given volume.
+type encryptionState struct {
+	VolName    string `json:"volName"`
+	MapperName string `json:"mapperName"`
+	Device     string `json:"device"`
+}
+
+// encryptionParams are the storage class parameters that opt a volume into
+// encryption at rest.
+type encryptionParams struct {
+	Encrypted    bool
+	KMSProvider  string
+	KMSConfigRef string
+}
+
+func parseEncryptionParams(volOpts map[string]string) encryptionParams {
+	return encryptionParams{
+		Encrypted:    volOpts["encrypted"] == "true",
+		KMSProvider:  volOpts["kmsProvider"],
+		KMSConfigRef: volOpts["kmsConfigRef"],
+	}
+}
+
+func mapperNameForVolume(volName string) string {
+	return "longhorn-" + volName
+}
+
+func encryptionStatePath(volName string) string {
+	return filepath.Join(encryptionStateDir, volName+".json")
+}
+
+// wrappedDEKPath returns where the KMS-wrapped DEK for volName is cached on
+// the node between publish calls, alongside the iSCSI state dir.
+func wrappedDEKPath(volName string) string {
+	return filepath.Join(encryptionStateDir, volName+".dek")
+}
+
+// encryptDevice opens device as a LUKS2 mapper, formatting it first if it is
+// not already a LUKS device, and returns the /dev/mapper/* path to use in
+// place of device for the remainder of NodePublishVolume. The DEK is
+// generated on first use, wrapped by the volume's configured kms.Provider,
+// and the wrapped copy is persisted to wrappedDEKPath so later attaches on
+// this node can retrieve it; rotateDEK rewrites that copy when it rotates
+// the key.
+func encryptDevice(exec exec.Interface, volName, device, wrappedDEKPath string, params encryptionParams) (string, error) {
+	provider, err := kms.New(kms.Config{Provider: params.KMSProvider, ConfigRef: params.KMSConfigRef})
+	if err != nil {
+		return "", fmt.Errorf("encryption: failed to initialize kms provider for volume %s: %v", volName, err)
+	}
+
+	dek, err := loadOrCreateDEK(provider, volName, wrappedDEKPath)
+	if err != nil {
+		return "", err
+	}
+
+	mapperName := mapperNameForVolume(volName)
+	mapperPath := filepath.Join("/dev/mapper", mapperName)
+
+	if !isLUKS(exec, device) {
+		if err := luksFormat(exec, device, dek); err != nil {
+			return "", fmt.Errorf("encryption: luksFormat failed for volume %s: %v", volName, err)
+		}
+	}
+
+	if err := luksOpen(exec, device, mapperName, dek); err != nil {
+		return "", fmt.Errorf("encryption: luksOpen failed for volume %s: %v", volName, err)
+	}
+
+	if err := saveEncryptionState(encryptionState{VolName: volName, MapperName: mapperName, Device: device}); err != nil {
+		return "", err
+	}
+
+	return mapperPath, nil
+}
+
+// decryptDevice closes the LUKS2 mapper opened for volName by encryptDevice,
+// if any. It is a no-op if the volume has no persisted encryption state,
+// which is the case for unencrypted volumes.
+func decryptDevice(exec exec.Interface, volName string) error {
+	state, err := loadEncryptionState(volName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := luksClose(exec, state.MapperName); err != nil {
+		return fmt.Errorf("encryption: luksClose failed for volume %s: %v", volName, err)
+	}
+
+	return os.Remove(encryptionStatePath(volName))
+}
+
+// RotateEncryptionKey is the entry point used by the rotateEncryptionKey API
+// action. It is a thin wrapper around rotateDEK using the host's real exec
+// interface, kept separate so tests can call rotateDEK with a fake exec.
+func RotateEncryptionKey(provider kms.Provider, volName string, wrappedDEK []byte) ([]byte, error) {
+	return rotateDEK(exec.New(), provider, volName, wrappedDEK)
+}
+
+// rotateDEK generates a fresh DEK for volName, adds it to the LUKS2 keyslots
+// of the active mapper device (if currently attached), removes the old
+// passphrase, and returns the newly wrapped DEK to persist on the volume CR.
+// If the volume is not currently attached on this node, only the wrapped DEK
+// is rotated; the new passphrase is added to the device on its next attach
+// via encryptDevice re-wrapping through the KMS.
+func rotateDEK(exec exec.Interface, provider kms.Provider, volName string, wrappedDEK []byte) ([]byte, error) {
+	oldDEK, err := provider.GetKey(volName, wrappedDEK)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: failed to unwrap current DEK for volume %s: %v", volName, err)
+	}
+
+	newDEK := make([]byte, dekSize)
+	if _, err := rand.Read(newDEK); err != nil {
+		return nil, fmt.Errorf("encryption: failed to generate new DEK for volume %s: %v", volName, err)
+	}
+
+	if state, err := loadEncryptionState(volName); err == nil {
+		if err := luksAddKey(exec, state.Device, oldDEK, newDEK); err != nil {
+			return nil, fmt.Errorf("encryption: luksAddKey failed for volume %s: %v", volName, err)
+		}
+		if err := luksRemoveKey(exec, state.Device, oldDEK); err != nil {
+			return nil, fmt.Errorf("encryption: luksRemoveKey failed for volume %s: %v", volName, err)
+		}
+	}
+
+	newWrappedDEK, err := provider.PutKey(volName, newDEK)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: failed to wrap new DEK for volume %s: %v", volName, err)
+	}
+
+	// If this node is the one with the volume attached, its cached wrapped
+	// DEK must move forward in lockstep with the LUKS2 keyslot swap above --
+	// otherwise a later publish on this node would load the now-removed old
+	// DEK from cache and fail to luksOpen.
+	if _, err := os.Stat(wrappedDEKPath(volName)); err == nil {
+		if err := ioutil.WriteFile(wrappedDEKPath(volName), newWrappedDEK, 0600); err != nil {
+			return nil, fmt.Errorf("encryption: failed to update cached wrapped DEK for volume %s: %v", volName, err)
+		}
+	}
+
+	return newWrappedDEK, nil
+}
+
+func loadOrCreateDEK(provider kms.Provider, volName, wrappedDEKPath string) ([]byte, error) {
+	existing, err := ioutil.ReadFile(wrappedDEKPath)
+	if err == nil {
+		return provider.GetKey(volName, existing)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("encryption: failed to read wrapped DEK for volume %s: %v", volName, err)
+	}
+
+	dek := make([]byte, dekSize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("encryption: failed to generate DEK for volume %s: %v", volName, err)
+	}
+
+	wrapped, err := provider.PutKey(volName, dek)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: failed to wrap DEK for volume %s: %v", volName, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(wrappedDEKPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(wrappedDEKPath, wrapped, 0600); err != nil {
+		return nil, fmt.Errorf("encryption: failed to persist wrapped DEK for volume %s: %v", volName, err)
+	}
+
+	return dek, nil
+}
+
+func saveEncryptionState(state encryptionState) error {
+	if err := os.MkdirAll(encryptionStateDir, 0700); err != nil {
+		return fmt.Errorf("encryption: failed to create state dir: %v", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(encryptionStatePath(state.VolName), data, 0600)
+}
+
+func loadEncryptionState(volName string) (encryptionState, error) {
+	var state encryptionState
+	data, err := ioutil.ReadFile(encryptionStatePath(volName))
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func isLUKS(exec exec.Interface, device string) bool {
+	_, err := exec.Command("cryptsetup", "isLuks", device).CombinedOutput()
+	return err == nil
+}
+
+func luksFormat(exec exec.Interface, device string, dek []byte) error {
+	cmd := exec.Command("cryptsetup", "luksFormat", "--type", "luks2", "--key-file", "-", device)
+	return runWithStdin(cmd, dek)
+}
+
+func luksOpen(exec exec.Interface, device, mapperName string, dek []byte) error {
+	cmd := exec.Command("cryptsetup", "luksOpen", "--key-file", "-", device, mapperName)
+	return runWithStdin(cmd, dek)
+}
+
+func luksClose(exec exec.Interface, mapperName string) error {
+	_, err := exec.Command("cryptsetup", "luksClose", mapperName).CombinedOutput()
+	return err
+}
+
+func luksAddKey(exec exec.Interface, device string, existingDEK, newDEK []byte) error {
+	keyfileSize := strconv.Itoa(dekSize)
+	cmd := exec.Command("cryptsetup", "luksAddKey",
+		"--key-file", "-", "--keyfile-size", keyfileSize,
+		"--new-keyfile-size", keyfileSize,
+		device, "-")
+	return runWithTwoStdins(cmd, existingDEK, newDEK)
+}
+
+func luksRemoveKey(exec exec.Interface, device string, dek []byte) error {
+	cmd := exec.Command("cryptsetup", "luksRemoveKey", device, "--key-file", "-")
+	return runWithStdin(cmd, dek)
+}
+
+// runWithStdin and runWithTwoStdins exist because k8s.io/utils/exec.Cmd does
+// not expose SetStdin directly on the interface the way os/exec does; both
+// cryptsetup invocations that take key material read it from stdin so it
+// never appears on the process command line or in logs.
+func runWithStdin(cmd exec.Cmd, data []byte) error {
+	cmd.SetStdin(bytes.NewReader(data))
+	_, err := cmd.CombinedOutput()
+	return err
+}
+
+// runWithTwoStdins feeds both keys to cryptsetup over a single stdin stream,
+// back to back with no separator: cryptsetup reads --key-file size-bounded
+// to --keyfile-size bytes for the existing key, then the positional
+// new-key-file argument size-bounded to --new-keyfile-size bytes for the
+// next. Without both size bounds the first read would consume the whole
+// stream, leaving nothing for the second.
+func runWithTwoStdins(cmd exec.Cmd, existingDEK, newDEK []byte) error {
+	combined := append(append([]byte{}, existingDEK...), newDEK...)
+	cmd.SetStdin(bytes.NewReader(combined))
+	_, err := cmd.CombinedOutput()
+	return err
+}
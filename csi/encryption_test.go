@@ -0,0 +1,154 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"k8s.io/utils/exec"
+	fakeexec "k8s.io/utils/exec/testing"
+)
+
+// fakeProvider is a kms.Provider whose GetKey/PutKey just record and replay
+// fixed byte slices, so rotateDEK's keyslot-swap sequencing can be asserted
+// against known DEK values instead of opaque ciphertext.
+type fakeProvider struct {
+	oldDEK        []byte
+	putKeyDEK     []byte
+	newWrappedDEK []byte
+}
+
+func (p *fakeProvider) GetKey(volName string, wrappedDEK []byte) ([]byte, error) {
+	return p.oldDEK, nil
+}
+
+func (p *fakeProvider) PutKey(volName string, dek []byte) ([]byte, error) {
+	p.putKeyDEK = dek
+	return p.newWrappedDEK, nil
+}
+
+func (p *fakeProvider) RotateKey(volName string, wrappedDEK []byte) ([]byte, error) {
+	return nil, fmt.Errorf("RotateKey not used by rotateDEK")
+}
+
+func TestRotateDEKSwapsKeyslotsBeforeWrapping(t *testing.T) {
+	encryptionStateDir = t.TempDir()
+
+	oldDEK := bytes.Repeat([]byte{0x11}, dekSize)
+	newWrappedDEK := []byte("new-wrapped-dek")
+	provider := &fakeProvider{oldDEK: oldDEK, newWrappedDEK: newWrappedDEK}
+
+	device := "/dev/mapper/longhorn-vol-1"
+	if err := saveEncryptionState(encryptionState{VolName: "vol-1", MapperName: "longhorn-vol-1", Device: device}); err != nil {
+		t.Fatalf("saveEncryptionState() = %v", err)
+	}
+
+	var calls []string
+	addKeyCmd := &fakeexec.FakeCmd{}
+	addKeyCmd.CombinedOutputScript = append(addKeyCmd.CombinedOutputScript, func() ([]byte, error) { return nil, nil })
+	removeKeyCmd := &fakeexec.FakeCmd{}
+	removeKeyCmd.CombinedOutputScript = append(removeKeyCmd.CombinedOutputScript, func() ([]byte, error) { return nil, nil })
+
+	fake := &fakeexec.FakeExec{
+		CommandScript: []fakeexec.FakeCommandAction{
+			func(cmd string, args ...string) exec.Cmd {
+				calls = append(calls, "luksAddKey")
+				return fakeexec.InitFakeCmd(addKeyCmd, cmd, args...)
+			},
+			func(cmd string, args ...string) exec.Cmd {
+				calls = append(calls, "luksRemoveKey")
+				return fakeexec.InitFakeCmd(removeKeyCmd, cmd, args...)
+			},
+		},
+	}
+
+	newWrapped, err := rotateDEK(fake, provider, "vol-1", []byte("old-wrapped-dek"))
+	if err != nil {
+		t.Fatalf("rotateDEK() = %v", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "luksAddKey" || calls[1] != "luksRemoveKey" {
+		t.Fatalf("rotateDEK() called cryptsetup in order %v, want [luksAddKey luksRemoveKey]", calls)
+	}
+
+	addKeyStdin, err := ioutil.ReadAll(addKeyCmd.Stdin)
+	if err != nil {
+		t.Fatalf("failed to read luksAddKey stdin: %v", err)
+	}
+	if want := append(append([]byte{}, oldDEK...), provider.putKeyDEK...); !bytes.Equal(addKeyStdin, want) {
+		t.Errorf("luksAddKey stdin = %x, want old DEK followed by new DEK %x", addKeyStdin, want)
+	}
+
+	removeKeyStdin, err := ioutil.ReadAll(removeKeyCmd.Stdin)
+	if err != nil {
+		t.Fatalf("failed to read luksRemoveKey stdin: %v", err)
+	}
+	if !bytes.Equal(removeKeyStdin, oldDEK) {
+		t.Errorf("luksRemoveKey stdin = %x, want old DEK %x", removeKeyStdin, oldDEK)
+	}
+
+	if !bytes.Equal(newWrapped, newWrappedDEK) {
+		t.Errorf("rotateDEK() returned %q, want %q", newWrapped, newWrappedDEK)
+	}
+	if len(provider.putKeyDEK) != dekSize {
+		t.Errorf("provider.PutKey was called with a %d-byte DEK, want %d", len(provider.putKeyDEK), dekSize)
+	}
+	if bytes.Equal(provider.putKeyDEK, oldDEK) {
+		t.Errorf("rotateDEK() wrapped the old DEK instead of generating a new one")
+	}
+}
+
+func TestRotateDEKUpdatesCachedWrappedDEK(t *testing.T) {
+	encryptionStateDir = t.TempDir()
+
+	oldDEK := bytes.Repeat([]byte{0x22}, dekSize)
+	newWrappedDEK := []byte("rotated-wrapped-dek")
+	provider := &fakeProvider{oldDEK: oldDEK, newWrappedDEK: newWrappedDEK}
+
+	// No persisted encryptionState means the volume isn't attached on this
+	// node; rotateDEK must skip the LUKS2 keyslot swap but still rotate and
+	// cache the wrapped DEK since a cache file already exists.
+	path := wrappedDEKPath("vol-2")
+	if err := os.MkdirAll(encryptionStateDir, 0700); err != nil {
+		t.Fatalf("failed to create encryption state dir: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("stale-wrapped-dek"), 0600); err != nil {
+		t.Fatalf("failed to seed wrapped DEK cache: %v", err)
+	}
+
+	fake := &fakeexec.FakeExec{}
+
+	newWrapped, err := rotateDEK(fake, provider, "vol-2", []byte("stale-wrapped-dek"))
+	if err != nil {
+		t.Fatalf("rotateDEK() = %v", err)
+	}
+	if !bytes.Equal(newWrapped, newWrappedDEK) {
+		t.Errorf("rotateDEK() returned %q, want %q", newWrapped, newWrappedDEK)
+	}
+
+	cached, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read wrapped DEK cache: %v", err)
+	}
+	if !bytes.Equal(cached, newWrappedDEK) {
+		t.Errorf("cached wrapped DEK = %q, want %q", cached, newWrappedDEK)
+	}
+}
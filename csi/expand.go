@@ -0,0 +1,120 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/utils/exec"
+)
+
+// multipathResizeTimeout bounds how long ExpandISCSIVolume waits for
+// `multipathd resize map` to report the device's new size after a rescan,
+// since the underlying target may take a few seconds to present the
+// updated capacity to every portal.
+const multipathResizeTimeout = 30 * time.Second
+const multipathResizePollInterval = 2 * time.Second
+
+// ExpandISCSIVolume implements the node-side half of NodeExpandVolume for a
+// volume published by this driver: it rescans every portal in the
+// persisted iscsiDiskState, waits for the multipath map to pick up the new
+// size, and grows the filesystem in place. For a volume published in block
+// mode only the rescan and the multipath resize run, since there is no
+// filesystem to grow.
+func ExpandISCSIVolume(volumeID string) error {
+	state, err := loadISCSIState(volumeID)
+	if err != nil {
+		return fmt.Errorf("expand: no iSCSI state for volume %s, cannot expand: %v", volumeID, err)
+	}
+
+	execIface := exec.New()
+
+	for _, portal := range state.Portals {
+		if out, err := execIface.Command("iscsiadm", "-m", "node", "-T", state.Iqn, "-p", portal, "-R").CombinedOutput(); err != nil {
+			return fmt.Errorf("expand: rescan of %s failed for volume %s: %v: %s", portal, volumeID, err, out)
+		}
+	}
+
+	if state.MultipathDevice != "" {
+		if err := waitForMultipathResize(execIface, state.MultipathDevice); err != nil {
+			return err
+		}
+	}
+
+	if state.Block {
+		return nil
+	}
+
+	device := state.MultipathDevice
+	if device == "" {
+		device = state.StagingDevice
+	}
+	return growFilesystem(execIface, device, state.StagingPath)
+}
+
+func waitForMultipathResize(execIface exec.Interface, multipathDevice string) error {
+	deadline := time.Now().Add(multipathResizeTimeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		if out, err := execIface.Command("multipathd", "resize", "map", multipathDevice).CombinedOutput(); err != nil {
+			lastErr = fmt.Errorf("multipathd resize map %s failed: %v: %s", multipathDevice, err, out)
+		} else {
+			return nil
+		}
+		time.Sleep(multipathResizePollInterval)
+	}
+	return fmt.Errorf("expand: timed out waiting for multipath device %s to resize: %v", multipathDevice, lastErr)
+}
+
+// growFilesystem grows the filesystem backed by device, detecting ext2/3/4
+// vs xfs with `blkid` and dispatching to the matching resize tool.
+// resize2fs takes the device directly; xfs_growfs instead takes the
+// filesystem's mountpoint, which is why mountpoint is threaded through
+// separately rather than derived from device. Other filesystem types are
+// left untouched; NodeExpandVolume callers should treat an unsupported type
+// as success since the block device has already grown.
+func growFilesystem(execIface exec.Interface, device, mountpoint string) error {
+	out, err := execIface.Command("blkid", "-o", "value", "-s", "TYPE", device).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("expand: failed to detect filesystem type on %s: %v: %s", device, err, out)
+	}
+
+	switch fsType := trimTrailingNewline(string(out)); fsType {
+	case "ext2", "ext3", "ext4":
+		if out, err := execIface.Command("resize2fs", device).CombinedOutput(); err != nil {
+			return fmt.Errorf("expand: resize2fs %s failed: %v: %s", device, err, out)
+		}
+	case "xfs":
+		if mountpoint == "" {
+			return fmt.Errorf("expand: no staging mountpoint recorded for %s, cannot xfs_growfs", device)
+		}
+		if out, err := execIface.Command("xfs_growfs", mountpoint).CombinedOutput(); err != nil {
+			return fmt.Errorf("expand: xfs_growfs %s failed: %v: %s", mountpoint, err, out)
+		}
+	default:
+		return nil
+	}
+	return nil
+}
+
+func trimTrailingNewline(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == '\n' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/utils/exec"
+	fakeexec "k8s.io/utils/exec/testing"
+)
+
+func blkidCmd(fsType string) fakeexec.FakeCommandAction {
+	return func(cmd string, args ...string) exec.Cmd {
+		fakeCmd := &fakeexec.FakeCmd{}
+		fakeCmd.CombinedOutputScript = append(fakeCmd.CombinedOutputScript, func() ([]byte, error) {
+			return []byte(fsType + "\n"), nil
+		})
+		return fakeexec.InitFakeCmd(fakeCmd, cmd, args...)
+	}
+}
+
+func resizeCmd(gotArgv *[]string) fakeexec.FakeCommandAction {
+	return func(cmd string, args ...string) exec.Cmd {
+		fakeCmd := &fakeexec.FakeCmd{}
+		fakeCmd.CombinedOutputScript = append(fakeCmd.CombinedOutputScript, func() ([]byte, error) { return nil, nil })
+		ret := fakeexec.InitFakeCmd(fakeCmd, cmd, args...)
+		*gotArgv = fakeCmd.Argv
+		return ret
+	}
+}
+
+func TestGrowFilesystemDispatchesByType(t *testing.T) {
+	tests := []struct {
+		name       string
+		fsType     string
+		device     string
+		mountpoint string
+		wantTool   string
+		wantArg    string
+	}{
+		{name: "ext4 resizes the device", fsType: "ext4", device: "/dev/mapper/mpath0", mountpoint: "/staging/vol", wantTool: "resize2fs", wantArg: "/dev/mapper/mpath0"},
+		{name: "ext3 resizes the device", fsType: "ext3", device: "/dev/sdb", mountpoint: "/staging/vol", wantTool: "resize2fs", wantArg: "/dev/sdb"},
+		{name: "xfs grows the mountpoint, not the device", fsType: "xfs", device: "/dev/mapper/mpath0", mountpoint: "/staging/vol", wantTool: "xfs_growfs", wantArg: "/staging/vol"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotArgv []string
+			fake := &fakeexec.FakeExec{
+				CommandScript: []fakeexec.FakeCommandAction{
+					blkidCmd(tt.fsType),
+					resizeCmd(&gotArgv),
+				},
+			}
+
+			if err := growFilesystem(fake, tt.device, tt.mountpoint); err != nil {
+				t.Fatalf("growFilesystem() = %v", err)
+			}
+
+			if len(gotArgv) == 0 || gotArgv[0] != tt.wantTool {
+				t.Fatalf("growFilesystem() ran %v, want first call to be %q", gotArgv, tt.wantTool)
+			}
+			if gotArgv[len(gotArgv)-1] != tt.wantArg {
+				t.Errorf("growFilesystem() ran %v, want last arg %q", gotArgv, tt.wantArg)
+			}
+		})
+	}
+}
+
+func TestGrowFilesystemUnsupportedTypeIsNoop(t *testing.T) {
+	fake := &fakeexec.FakeExec{
+		CommandScript: []fakeexec.FakeCommandAction{
+			blkidCmd("btrfs"),
+		},
+	}
+
+	if err := growFilesystem(fake, "/dev/sdb", "/staging/vol"); err != nil {
+		t.Fatalf("growFilesystem() = %v, want nil for an unsupported but harmless fs type", err)
+	}
+}
+
+func TestGrowFilesystemXFSWithoutMountpointFails(t *testing.T) {
+	fake := &fakeexec.FakeExec{
+		CommandScript: []fakeexec.FakeCommandAction{
+			blkidCmd("xfs"),
+		},
+	}
+
+	err := growFilesystem(fake, "/dev/sdb", "")
+	if err == nil {
+		t.Fatal("growFilesystem() = nil, want an error when xfs has no staging mountpoint to grow")
+	}
+	if !strings.Contains(err.Error(), "/dev/sdb") {
+		t.Errorf("growFilesystem() error = %v, want it to name the device", err)
+	}
+}
@@ -19,14 +19,18 @@ package csi
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	iscsiLib "github.com/kubernetes-csi/csi-lib-iscsi/iscsi"
 	"k8s.io/kubernetes/pkg/volume/util"
 	"k8s.io/utils/exec"
 	"k8s.io/utils/mount"
+
+	"github.com/rancher/longhorn-manager/pkg/logutil"
 )
 
 type iscsiContext struct {
@@ -39,6 +43,9 @@ type iscsiContext struct {
 	InitiatorName     string
 	DiscoveryCHAPAuth string
 	SessionCHAPAuth   string
+	Encrypted         string
+	KMSProvider       string
+	KMSConfigRef      string
 }
 
 const defaultPort = "3260"
@@ -130,7 +137,9 @@ func getISCSIInfo(req *csi.NodePublishVolumeRequest, ctx iscsiContext) (*iscsiDi
 		secret:          secret,
 		sessionSecret:   sessionSecret,
 		discoverySecret: discoverySecret,
-		InitiatorName:   initiatorName}, nil
+		InitiatorName:   initiatorName,
+		encryption:      parseEncryptionParams(map[string]string{"encrypted": ctx.Encrypted, "kmsProvider": ctx.KMSProvider, "kmsConfigRef": ctx.KMSConfigRef}),
+	}, nil
 }
 
 func buildISCSIConnector(iscsiInfo *iscsiDisk) *iscsiLib.Connector {
@@ -171,15 +180,19 @@ func buildISCSIConnector(iscsiInfo *iscsiDisk) *iscsiLib.Connector {
 }
 
 func getISCSIDiskMounter(iscsiInfo *iscsiDisk, req *csi.NodePublishVolumeRequest) *iscsiDiskMounter {
+	logrus.Debugf("NodePublishVolume: %s", logutil.Sanitize(req))
+
 	readOnly := req.GetReadonly()
 	fsType := req.GetVolumeCapability().GetMount().GetFsType()
 	mountOptions := req.GetVolumeCapability().GetMount().GetMountFlags()
+	block := req.GetVolumeCapability().GetBlock() != nil
 
 	return &iscsiDiskMounter{
 		iscsiDisk:    iscsiInfo,
 		fsType:       fsType,
 		readOnly:     readOnly,
 		mountOptions: mountOptions,
+		block:        block,
 		mounter:      &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: exec.New()},
 		exec:         exec.New(),
 		targetPath:   req.GetTargetPath(),
@@ -188,23 +201,81 @@ func getISCSIDiskMounter(iscsiInfo *iscsiDisk, req *csi.NodePublishVolumeRequest
 	}
 }
 
-func getISCSIDiskUnmounter(req *csi.NodeUnpublishVolumeRequest) *iscsiDiskUnmounter {
-	return &iscsiDiskUnmounter{
-		iscsiDisk: &iscsiDisk{
-			VolName: req.GetVolumeId(),
-		},
-		mounter: mount.New(""),
-		exec:    exec.New(),
+// mountDevice returns the device path NodePublishVolume should format and
+// mount: for an encrypted volume, device is first opened as a LUKS2 mapper
+// via cryptsetup and the resulting /dev/mapper/* path is returned instead.
+// It must be called after connector.Connect() has returned device and
+// before SafeFormatAndMount runs.
+func (m *iscsiDiskMounter) mountDevice(device string) (string, error) {
+	if !m.iscsiDisk.encryption.Encrypted {
+		return device, nil
 	}
+	return encryptDevice(m.exec, m.VolName, device, wrappedDEKPath(m.VolName), m.iscsiDisk.encryption)
 }
 
+// publishBlockDevice bind-mounts device, the raw multipath (or LUKS2
+// mapper) device node, directly onto targetPath without formatting it,
+// for a VolumeCapability_Block request. targetPath is first created as an
+// empty regular file if it does not already exist.
+func (m *iscsiDiskMounter) publishBlockDevice(device string) error {
+	if err := makeFile(m.targetPath); err != nil {
+		return fmt.Errorf("iscsi: failed to create block device target %s: %v", m.targetPath, err)
+	}
+	return m.mounter.Mount(device, m.targetPath, "", []string{"bind"})
+}
+
+// makeFile creates an empty regular file at path if it does not already
+// exist, the same way kubelet prepares a block-mode publish target.
+func makeFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	return f.Close()
+}
+
+// persistState records the portals, IQN, iface, multipath map name, and
+// staging details used to attach this volume, so a later
+// NodeUnpublishVolume call -- which only receives the volume ID -- can
+// reconstruct enough of iscsiDisk to log out of every portal and tear down
+// the multipath map cleanly, and so NodeExpandVolume can find the device to
+// grow. It must be called once connector.Connect() has returned the
+// multipath device name.
+func (m *iscsiDiskMounter) persistState(multipathDevice, stagingPath string) error {
+	return saveISCSIState(m.iscsiDisk, multipathDevice, stagingPath, multipathDevice, m.block)
+}
+
+func getISCSIDiskUnmounter(req *csi.NodeUnpublishVolumeRequest) *iscsiDiskUnmounter {
+	logrus.Debugf("NodeUnpublishVolume: %s", logutil.Sanitize(req))
+
+	return getISCSIDiskUnmounterForVolume(req.GetVolumeId())
+}
+
+// getISCSIDiskUnmounterForVolume reloads the iscsiDisk persisted by
+// persistState at publish time, if any, so the unmounter has the portals,
+// IQN, iface and multipath map name it needs to clean up fully even though
+// NodeUnpublishVolume only carries the volume ID.
 func getISCSIDiskUnmounterForVolume(volumeID string) *iscsiDiskUnmounter {
+	disk := &iscsiDisk{VolName: volumeID}
+	multipathDevice := ""
+
+	if state, err := loadISCSIState(volumeID); err == nil {
+		disk.Portals = state.Portals
+		disk.Iqn = state.Iqn
+		disk.lun = state.Lun
+		disk.Iface = state.Iface
+		disk.InitiatorName = state.InitiatorName
+		multipathDevice = state.MultipathDevice
+	}
+
 	return &iscsiDiskUnmounter{
-		iscsiDisk: &iscsiDisk{
-			VolName: volumeID,
-		},
-		mounter: mount.New(""),
-		exec:    exec.New(),
+		iscsiDisk:       disk,
+		mounter:         mount.New(""),
+		exec:            exec.New(),
+		multipathDevice: multipathDevice,
 	}
 }
 
@@ -285,6 +356,7 @@ type iscsiDisk struct {
 	discoverySecret iscsiLib.Secrets
 	InitiatorName   string
 	VolName         string
+	encryption      encryptionParams
 }
 
 type iscsiDiskMounter struct {
@@ -292,6 +364,7 @@ type iscsiDiskMounter struct {
 	readOnly     bool
 	fsType       string
 	mountOptions []string
+	block        bool
 	mounter      *mount.SafeFormatAndMount
 	exec         exec.Interface
 	deviceUtil   util.DeviceUtil
@@ -301,6 +374,50 @@ type iscsiDiskMounter struct {
 
 type iscsiDiskUnmounter struct {
 	*iscsiDisk
-	mounter mount.Interface
-	exec    exec.Interface
-}
\ No newline at end of file
+	mounter         mount.Interface
+	exec            exec.Interface
+	multipathDevice string
+}
+
+// unmountDevice closes the LUKS2 mapper opened by mountDevice, if the volume
+// was encrypted, and is a no-op otherwise. It must run before
+// logoutAndCleanup in NodeUnpublishVolume, since the LUKS2 mapper holds
+// the multipath device open until cryptsetup luksClose releases it.
+func (u *iscsiDiskUnmounter) unmountDevice() error {
+	return decryptDevice(u.exec, u.VolName)
+}
+
+// logoutAndCleanup flushes and removes the dm-multipath map for this
+// volume, then logs out of and deletes the node record for every portal
+// used at publish time, finally removing the persisted state file -- but
+// only once every portal has been cleanly logged out, so a partial failure
+// leaves enough state behind to retry. It must run after unmountDevice,
+// since the LUKS2 mapper sits on top of the multipath device and
+// `multipath -f` fails on a map that is still held open.
+func (u *iscsiDiskUnmounter) logoutAndCleanup() error {
+	state := &iscsiDiskState{
+		VolName:         u.VolName,
+		Portals:         u.Portals,
+		Iqn:             u.Iqn,
+		Lun:             u.lun,
+		Iface:           u.Iface,
+		InitiatorName:   u.InitiatorName,
+		MultipathDevice: u.multipathDevice,
+	}
+
+	if len(state.Portals) == 0 {
+		// No persisted state (e.g. volume was never fully published, or
+		// this is an upgrade from a node that predates state tracking) --
+		// nothing more we can clean up.
+		return nil
+	}
+
+	if err := cleanupISCSISession(u.exec, state); err != nil {
+		return err
+	}
+
+	if err := deleteISCSIState(u.VolName); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("iscsi: failed to remove state for volume %s: %v", u.VolName, err)
+	}
+	return nil
+}
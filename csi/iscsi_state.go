@@ -0,0 +1,197 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/utils/exec"
+)
+
+// iscsiStateDir holds one JSON file per published volume recording the full
+// iscsiDisk used to attach it (portals, IQN, iface, lun, multipath map
+// name), so NodeUnpublishVolume can clean up a multipath session without
+// the CO (Kubernetes) re-supplying the original NodePublishVolumeRequest
+// volume context. It is a var, not a const, so tests can point it at a
+// t.TempDir() instead of the real host path.
+var iscsiStateDir = "/var/lib/longhorn/iscsi"
+
+func iscsiStatePath(volName string) string {
+	return filepath.Join(iscsiStateDir, volName+".json")
+}
+
+// iscsiDiskState is the subset of iscsiDisk persisted to disk at publish
+// time. CHAP secrets are intentionally excluded; logout and session
+// teardown do not require them.
+type iscsiDiskState struct {
+	VolName         string   `json:"volName"`
+	Portals         []string `json:"portals"`
+	Iqn             string   `json:"iqn"`
+	Lun             int32    `json:"lun"`
+	Iface           string   `json:"iface"`
+	InitiatorName   string   `json:"initiatorName"`
+	MultipathDevice string   `json:"multipathDevice"`
+	// StagingPath and StagingDevice are the mount path and the multipath
+	// device recorded by persistState at publish time (this driver has no
+	// NodeStageVolume); they let ExpandISCSIVolume and ReclaimSpace find the
+	// device and mountpoint without a fresh Connect().
+	StagingPath   string `json:"stagingPath,omitempty"`
+	StagingDevice string `json:"stagingDevice,omitempty"`
+	// Block is true when the volume was published with VolumeCapability_Block,
+	// in which case NodeExpandVolume only needs to grow the multipath map,
+	// not a filesystem.
+	Block bool `json:"block"`
+}
+
+// saveISCSIState persists disk's attach-time identity, along with the
+// multipath device map name Connect() returned and the staging details
+// NodeExpandVolume needs later, so it can be reloaded by
+// getISCSIDiskUnmounterForVolume for an unpublish that has no access to the
+// original NodePublishVolumeRequest.
+func saveISCSIState(disk *iscsiDisk, multipathDevice, stagingPath, stagingDevice string, block bool) error {
+	if err := os.MkdirAll(iscsiStateDir, 0700); err != nil {
+		return fmt.Errorf("iscsi: failed to create state dir: %v", err)
+	}
+
+	state := iscsiDiskState{
+		VolName:         disk.VolName,
+		Portals:         disk.Portals,
+		Iqn:             disk.Iqn,
+		Lun:             disk.lun,
+		Iface:           disk.Iface,
+		InitiatorName:   disk.InitiatorName,
+		MultipathDevice: multipathDevice,
+		StagingPath:     stagingPath,
+		StagingDevice:   stagingDevice,
+		Block:           block,
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(iscsiStatePath(disk.VolName), data, 0600)
+}
+
+func loadISCSIState(volName string) (*iscsiDiskState, error) {
+	data, err := ioutil.ReadFile(iscsiStatePath(volName))
+	if err != nil {
+		return nil, err
+	}
+
+	state := &iscsiDiskState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("iscsi: failed to parse state for volume %s: %v", volName, err)
+	}
+	return state, nil
+}
+
+func deleteISCSIState(volName string) error {
+	return os.Remove(iscsiStatePath(volName))
+}
+
+// listISCSIStates returns the persisted state for every volume this node
+// currently believes is published, used for startup reconciliation.
+func listISCSIStates() ([]*iscsiDiskState, error) {
+	entries, err := ioutil.ReadDir(iscsiStateDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("iscsi: failed to read state dir: %v", err)
+	}
+
+	var states []*iscsiDiskState
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		volName := strings.TrimSuffix(entry.Name(), ".json")
+		state, err := loadISCSIState(volName)
+		if err != nil {
+			continue
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// cleanupISCSISession flushes and removes the multipath map (if any) and
+// logs out of every portal in state, deleting the node records so a
+// subsequent discovery starts clean. It is the teardown counterpart to
+// buildISCSIConnector/Connect and is safe to retry.
+func cleanupISCSISession(execIface exec.Interface, state *iscsiDiskState) error {
+	if state.MultipathDevice != "" {
+		if out, err := execIface.Command("multipath", "-f", state.MultipathDevice).CombinedOutput(); err != nil {
+			return fmt.Errorf("iscsi: failed to flush multipath device %s: %v: %s", state.MultipathDevice, err, out)
+		}
+	}
+
+	var errs []string
+	for _, portal := range state.Portals {
+		if out, err := execIface.Command("iscsiadm", "-m", "node", "-T", state.Iqn, "-p", portal, "-u").CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Sprintf("logout of %s failed: %v: %s", portal, err, out))
+			continue
+		}
+		if out, err := execIface.Command("iscsiadm", "-m", "node", "-T", state.Iqn, "-p", portal, "-o", "delete").CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Sprintf("delete node record for %s failed: %v: %s", portal, err, out))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("iscsi: cleanup for volume %s incomplete: %s", state.VolName, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ReconcileISCSISessions runs once at driver startup. It walks the state
+// dir and cleans up any persisted session whose volume is no longer known
+// to the CO (present is the set of volume IDs the CO still expects to be
+// published on this node), so a node restart does not leave stale iSCSI
+// sessions and dm-multipath maps behind indefinitely.
+func ReconcileISCSISessions(present map[string]bool) error {
+	states, err := listISCSIStates()
+	if err != nil {
+		return err
+	}
+
+	execIface := exec.New()
+	var errs []string
+	for _, state := range states {
+		if present[state.VolName] {
+			continue
+		}
+		if err := cleanupISCSISession(execIface, state); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := deleteISCSIState(state.VolName); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("iscsi: reconciliation encountered errors: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/utils/exec"
+	fakeexec "k8s.io/utils/exec/testing"
+)
+
+func okCmd(calls *[]string, label string) fakeexec.FakeCommandAction {
+	return func(cmd string, args ...string) exec.Cmd {
+		*calls = append(*calls, label)
+		fakeCmd := &fakeexec.FakeCmd{}
+		fakeCmd.CombinedOutputScript = append(fakeCmd.CombinedOutputScript, func() ([]byte, error) { return nil, nil })
+		return fakeexec.InitFakeCmd(fakeCmd, cmd, args...)
+	}
+}
+
+func failingCmd(calls *[]string, label string) fakeexec.FakeCommandAction {
+	return func(cmd string, args ...string) exec.Cmd {
+		*calls = append(*calls, label)
+		fakeCmd := &fakeexec.FakeCmd{}
+		fakeCmd.CombinedOutputScript = append(fakeCmd.CombinedOutputScript, func() ([]byte, error) {
+			return []byte("boom"), errFakeCommand
+		})
+		return fakeexec.InitFakeCmd(fakeCmd, cmd, args...)
+	}
+}
+
+func TestCleanupISCSISessionLogsOutAndDeletesEveryPortal(t *testing.T) {
+	state := &iscsiDiskState{
+		VolName:         "vol-1",
+		Iqn:             "iqn.2019-01.com.rancher:vol-1",
+		Portals:         []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+		MultipathDevice: "/dev/mapper/mpath0",
+	}
+
+	var calls []string
+	fake := &fakeexec.FakeExec{
+		CommandScript: []fakeexec.FakeCommandAction{
+			okCmd(&calls, "multipath -f"),
+			okCmd(&calls, "logout portal 1"),
+			okCmd(&calls, "delete node record 1"),
+			okCmd(&calls, "logout portal 2"),
+			okCmd(&calls, "delete node record 2"),
+		},
+	}
+
+	if err := cleanupISCSISession(fake, state); err != nil {
+		t.Fatalf("cleanupISCSISession() = %v", err)
+	}
+
+	want := []string{"multipath -f", "logout portal 1", "delete node record 1", "logout portal 2", "delete node record 2"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("cleanupISCSISession() issued commands %v, want %v", calls, want)
+	}
+}
+
+func TestCleanupISCSISessionSkipsMultipathFlushWhenNotMultipathed(t *testing.T) {
+	state := &iscsiDiskState{
+		VolName: "vol-2",
+		Iqn:     "iqn.2019-01.com.rancher:vol-2",
+		Portals: []string{"10.0.0.1:3260"},
+	}
+
+	var calls []string
+	fake := &fakeexec.FakeExec{
+		CommandScript: []fakeexec.FakeCommandAction{
+			okCmd(&calls, "logout"),
+			okCmd(&calls, "delete node record"),
+		},
+	}
+
+	if err := cleanupISCSISession(fake, state); err != nil {
+		t.Fatalf("cleanupISCSISession() = %v", err)
+	}
+	if len(calls) != 2 {
+		t.Errorf("cleanupISCSISession() issued %d commands, want 2 (no multipath flush): %v", len(calls), calls)
+	}
+}
+
+func TestCleanupISCSISessionAggregatesPerPortalErrors(t *testing.T) {
+	state := &iscsiDiskState{
+		VolName: "vol-3",
+		Iqn:     "iqn.2019-01.com.rancher:vol-3",
+		Portals: []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+	}
+
+	var calls []string
+	fake := &fakeexec.FakeExec{
+		CommandScript: []fakeexec.FakeCommandAction{
+			failingCmd(&calls, "logout portal 1 fails"),
+			okCmd(&calls, "logout portal 2"),
+			okCmd(&calls, "delete node record 2"),
+		},
+	}
+
+	err := cleanupISCSISession(fake, state)
+	if err == nil {
+		t.Fatal("cleanupISCSISession() = nil, want an error aggregating the failed portal")
+	}
+	if !strings.Contains(err.Error(), "vol-3") || !strings.Contains(err.Error(), "10.0.0.1:3260") {
+		t.Errorf("cleanupISCSISession() error = %v, want it to name the volume and failed portal", err)
+	}
+	// The second portal is still attempted even though the first failed.
+	if len(calls) != 3 {
+		t.Errorf("cleanupISCSISession() issued %d commands, want 3 (second portal still attempted): %v", len(calls), calls)
+	}
+}
+
+var errFakeCommand = fakeCommandError("fake command failed")
+
+type fakeCommandError string
+
+func (e fakeCommandError) Error() string { return string(e) }
@@ -0,0 +1,48 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi
+
+import (
+	"fmt"
+
+	"k8s.io/utils/exec"
+)
+
+// ReclaimSpace runs fstrim against the staging path recorded for volumeID
+// by persistState at publish time, freeing blocks the filesystem has released back
+// to the thin-provisioned Longhorn replica. It is the node-local
+// implementation backing the csiaddons ReclaimSpace RPC, which is served by
+// this same node plugin process and so can reuse the persisted iSCSI
+// state directly instead of re-deriving the mount point. It is a no-op for
+// a volume published in block mode, since there is no filesystem to trim.
+func ReclaimSpace(volumeID string) error {
+	state, err := loadISCSIState(volumeID)
+	if err != nil {
+		return fmt.Errorf("reclaim: no iSCSI state for volume %s: %v", volumeID, err)
+	}
+	if state.Block {
+		return nil
+	}
+	if state.StagingPath == "" {
+		return fmt.Errorf("reclaim: volume %s has no recorded staging path", volumeID)
+	}
+
+	if out, err := exec.New().Command("fstrim", state.StagingPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("reclaim: fstrim failed for volume %s: %v: %s", volumeID, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csiaddons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/longhorn-manager/manager"
+	"github.com/rancher/longhorn-manager/pkg/csiaddons/rpc"
+)
+
+// backupServer implements the Backup RPC, the out-of-band equivalent of
+// the snapshotBackup volume action in api.NewRouter.
+type backupServer struct {
+	rpc.UnimplementedBackupServer
+	man *manager.VolumeManager
+}
+
+func (s *backupServer) Backup(ctx context.Context, req *rpc.BackupRequest) (*rpc.BackupResponse, error) {
+	name, err := s.man.VolumeBackupCreate(req.VolumeId, req.SnapshotName, req.BackupTarget)
+	if err != nil {
+		return nil, fmt.Errorf("csiaddons: failed to create backup for volume %s: %v", req.VolumeId, err)
+	}
+	return &rpc.BackupResponse{BackupName: name}, nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csiaddons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/longhorn-manager/csi"
+	"github.com/rancher/longhorn-manager/manager"
+	"github.com/rancher/longhorn-manager/pkg/csiaddons/rpc"
+	"github.com/rancher/longhorn-manager/pkg/kms"
+)
+
+// encryptionKeyRotateServer implements the EncryptionKeyRotate RPC, the
+// out-of-band equivalent of the rotateEncryptionKey volume action in
+// api.NewRouter.
+type encryptionKeyRotateServer struct {
+	rpc.UnimplementedEncryptionKeyRotateServer
+	man *manager.VolumeManager
+}
+
+func (s *encryptionKeyRotateServer) EncryptionKeyRotate(ctx context.Context, req *rpc.EncryptionKeyRotateRequest) (*rpc.EncryptionKeyRotateResponse, error) {
+	volume, err := s.man.GetVolume(req.VolumeId)
+	if err != nil {
+		return nil, fmt.Errorf("csiaddons: failed to get volume %s: %v", req.VolumeId, err)
+	}
+	if !volume.Encrypted {
+		return nil, fmt.Errorf("csiaddons: volume %s is not encrypted", req.VolumeId)
+	}
+
+	provider, err := kms.New(kms.Config{Provider: volume.KMSProvider, ConfigRef: volume.KMSConfigRef})
+	if err != nil {
+		return nil, fmt.Errorf("csiaddons: failed to initialize kms provider for volume %s: %v", req.VolumeId, err)
+	}
+
+	newWrappedDEK, err := csi.RotateEncryptionKey(provider, req.VolumeId, volume.WrappedDEK)
+	if err != nil {
+		return nil, fmt.Errorf("csiaddons: failed to rotate encryption key for volume %s: %v", req.VolumeId, err)
+	}
+
+	volume.WrappedDEK = newWrappedDEK
+	if _, err := s.man.UpdateVolume(volume); err != nil {
+		return nil, fmt.Errorf("csiaddons: failed to persist rotated encryption key for volume %s: %v", req.VolumeId, err)
+	}
+
+	return &rpc.EncryptionKeyRotateResponse{}, nil
+}
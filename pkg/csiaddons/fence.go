@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csiaddons
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/utils/exec"
+
+	"github.com/rancher/longhorn-manager/manager"
+	"github.com/rancher/longhorn-manager/pkg/csiaddons/rpc"
+)
+
+// networkFenceServer implements NetworkFence, which blocklists the given
+// node CIDRs from logging in to a volume's iSCSI target so a failed-over
+// volume cannot be double-mounted by the node RWO semantics assumed it had
+// released -- the same fencing role other CSI drivers give a dedicated
+// NetworkFence RPC.
+type networkFenceServer struct {
+	rpc.UnimplementedNetworkFenceServer
+	man *manager.VolumeManager
+}
+
+func (s *networkFenceServer) FenceNodes(ctx context.Context, req *rpc.FenceNodesRequest) (*rpc.FenceNodesResponse, error) {
+	if err := s.updateInitiatorACL(req.VolumeId, req.NodeCidrs, true); err != nil {
+		return nil, err
+	}
+	return &rpc.FenceNodesResponse{}, nil
+}
+
+func (s *networkFenceServer) UnfenceNodes(ctx context.Context, req *rpc.FenceNodesRequest) (*rpc.FenceNodesResponse, error) {
+	if err := s.updateInitiatorACL(req.VolumeId, req.NodeCidrs, false); err != nil {
+		return nil, err
+	}
+	return &rpc.FenceNodesResponse{}, nil
+}
+
+// updateInitiatorACL binds (unfence) or unbinds (fence) cidrs against the
+// volume's tgt target ID, the same tgtadm accept-address mechanism the
+// Longhorn engine uses to control which initiators may log in to a
+// volume's iSCSI target. Unbinding a CIDR refuses new logins from that
+// range; a session already open from it is not torn down by this call.
+func (s *networkFenceServer) updateInitiatorACL(volumeID string, cidrs []string, deny bool) error {
+	volume, err := s.man.GetVolume(volumeID)
+	if err != nil {
+		return fmt.Errorf("csiaddons: failed to get volume %s: %v", volumeID, err)
+	}
+
+	op := "unbind"
+	if !deny {
+		op = "bind"
+	}
+
+	execIface := exec.New()
+	var errs []string
+	for _, cidr := range cidrs {
+		args := []string{"--lld", "iscsi", "--mode", "target", "--op", op,
+			"--tid", fmt.Sprintf("%d", volume.IscsiTargetID), "-I", cidr}
+		if out, err := execIface.Command("tgtadm", args...).CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s failed: %v: %s", op, cidr, err, out))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("csiaddons: fencing update for volume %s incomplete: %s", volumeID, strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csiaddons
+
+import (
+	"context"
+
+	"github.com/rancher/longhorn-manager/pkg/csiaddons/rpc"
+)
+
+// identityServer lets a caller probe which of this sidecar's RPCs are
+// actually implemented, mirroring CSI's own GetPluginCapabilities pattern.
+// Every RPC in this package is always supported, so the list is static.
+type identityServer struct {
+	rpc.UnimplementedIdentityServer
+}
+
+func (s *identityServer) GetCapabilities(ctx context.Context, req *rpc.GetCapabilitiesRequest) (*rpc.GetCapabilitiesResponse, error) {
+	types := []rpc.Capability_Type{
+		rpc.Capability_RECLAIM_SPACE,
+		rpc.Capability_SNAPSHOT,
+		rpc.Capability_BACKUP,
+		rpc.Capability_ENCRYPTION_KEY_ROTATE,
+		rpc.Capability_NETWORK_FENCE,
+	}
+
+	capabilities := make([]*rpc.Capability, 0, len(types))
+	for _, t := range types {
+		capabilities = append(capabilities, &rpc.Capability{Type: t})
+	}
+
+	return &rpc.GetCapabilitiesResponse{Capabilities: capabilities}, nil
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csiaddons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/longhorn-manager/csi"
+	"github.com/rancher/longhorn-manager/pkg/csiaddons/rpc"
+)
+
+// reclaimSpaceServer implements the ReclaimSpace RPC. The actual work
+// happens in the csi package, which already tracks the staging path for
+// each published volume; this server is just the gRPC-facing adapter.
+type reclaimSpaceServer struct {
+	rpc.UnimplementedReclaimSpaceServer
+}
+
+func (s *reclaimSpaceServer) ReclaimSpace(ctx context.Context, req *rpc.ReclaimSpaceRequest) (*rpc.ReclaimSpaceResponse, error) {
+	if err := csi.ReclaimSpace(req.VolumeId); err != nil {
+		return nil, fmt.Errorf("csiaddons: %v", err)
+	}
+	return &rpc.ReclaimSpaceResponse{}, nil
+}
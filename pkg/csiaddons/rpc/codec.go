@@ -0,0 +1,53 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+// jsonCodec marshals the message types in this package with encoding/json
+// instead of real protobuf wire encoding: this directory has no protoc
+// toolchain wired into the build yet (see generate.go), so the message
+// types here are plain hand-written Go structs rather than protoc-gen-go
+// output, and cannot satisfy the real proto.Message interface. Every field
+// in this package is exported and JSON-tagged, so the round trip is
+// lossless.
+//
+// Name deliberately does not return "proto", the content-subtype grpc-go's
+// client and server fall back to by default: the csiaddons sidecar this
+// package implements runs in the same process as the main CSI NodeServer
+// (see csi/reclaim.go), which talks real protobuf wire format. Registering
+// under "proto" would silently replace that unrelated server's codec too.
+// ServerCodec below scopes jsonCodec to just this package's own
+// *grpc.Server instead.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (jsonCodec) Name() string { return "csiaddons-json" }
+
+// ServerCodec returns the grpc.ServerOption that wires jsonCodec into a
+// *grpc.Server, without touching the process-wide "proto" codec every
+// other grpc.Server in this process keeps using.
+func ServerCodec() grpc.ServerOption {
+	return grpc.ForceServerCodec(jsonCodec{})
+}
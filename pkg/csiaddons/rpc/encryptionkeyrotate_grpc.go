@@ -0,0 +1,74 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EncryptionKeyRotateServer is the server API for the EncryptionKeyRotate
+// service.
+type EncryptionKeyRotateServer interface {
+	EncryptionKeyRotate(context.Context, *EncryptionKeyRotateRequest) (*EncryptionKeyRotateResponse, error)
+}
+
+// UnimplementedEncryptionKeyRotateServer must be embedded by every
+// EncryptionKeyRotateServer implementation to stay source-compatible with
+// methods added to the interface later.
+type UnimplementedEncryptionKeyRotateServer struct{}
+
+func (UnimplementedEncryptionKeyRotateServer) EncryptionKeyRotate(context.Context, *EncryptionKeyRotateRequest) (*EncryptionKeyRotateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method EncryptionKeyRotate not implemented")
+}
+
+// RegisterEncryptionKeyRotateServer registers srv with s so it handles
+// EncryptionKeyRotate RPCs.
+func RegisterEncryptionKeyRotateServer(s *grpc.Server, srv EncryptionKeyRotateServer) {
+	s.RegisterService(&encryptionKeyRotateServiceDesc, srv)
+}
+
+func encryptionKeyRotateHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EncryptionKeyRotateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncryptionKeyRotateServer).EncryptionKeyRotate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/csiaddons.rancher.longhorn.v1.EncryptionKeyRotate/EncryptionKeyRotate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncryptionKeyRotateServer).EncryptionKeyRotate(ctx, req.(*EncryptionKeyRotateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var encryptionKeyRotateServiceDesc = grpc.ServiceDesc{
+	ServiceName: "csiaddons.rancher.longhorn.v1.EncryptionKeyRotate",
+	HandlerType: (*EncryptionKeyRotateServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "EncryptionKeyRotate", Handler: encryptionKeyRotateHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "csiaddons.proto",
+}
@@ -0,0 +1,29 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rpc holds the Go bindings for the csiaddons.proto service
+// definitions in this directory: one request/response struct per message
+// in messages.go, and hand-written server interfaces, Register*Server
+// functions and grpc.ServiceDesc values per service in *_grpc.go, wired to
+// a JSON-based grpc.Codec in codec.go. These are hand-written stand-ins,
+// not protoc output -- this repo has no protoc/protoc-gen-go-grpc toolchain
+// wired into its build yet. The //go:generate directive below is the
+// target command once that toolchain lands; until then, keep messages.go
+// and the service descriptors in this package in sync with
+// csiaddons.proto by hand.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative csiaddons.proto
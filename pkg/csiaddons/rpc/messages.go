@@ -0,0 +1,82 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpc
+
+// Message types for the services defined in csiaddons.proto. These are
+// hand-written, not protoc output -- see the package doc in generate.go for
+// why -- so every field is tagged for encoding/json and the JSON tags match
+// the .proto field names exactly to keep the two in sync by inspection.
+
+type GetCapabilitiesRequest struct{}
+
+// Capability_Type mirrors the Capability.Type enum in csiaddons.proto.
+type Capability_Type int32
+
+const (
+	Capability_UNKNOWN               Capability_Type = 0
+	Capability_RECLAIM_SPACE         Capability_Type = 1
+	Capability_SNAPSHOT              Capability_Type = 2
+	Capability_BACKUP                Capability_Type = 3
+	Capability_ENCRYPTION_KEY_ROTATE Capability_Type = 4
+	Capability_NETWORK_FENCE         Capability_Type = 5
+)
+
+type Capability struct {
+	Type Capability_Type `json:"type"`
+}
+
+type GetCapabilitiesResponse struct {
+	Capabilities []*Capability `json:"capabilities"`
+}
+
+type ReclaimSpaceRequest struct {
+	VolumeId string `json:"volume_id"`
+}
+
+type ReclaimSpaceResponse struct{}
+
+type SnapshotRequest struct {
+	VolumeId     string `json:"volume_id"`
+	SnapshotName string `json:"snapshot_name"`
+}
+
+type SnapshotResponse struct {
+	SnapshotName string `json:"snapshot_name"`
+}
+
+type BackupRequest struct {
+	VolumeId     string `json:"volume_id"`
+	SnapshotName string `json:"snapshot_name"`
+	BackupTarget string `json:"backup_target"`
+}
+
+type BackupResponse struct {
+	BackupName string `json:"backup_name"`
+}
+
+type EncryptionKeyRotateRequest struct {
+	VolumeId string `json:"volume_id"`
+}
+
+type EncryptionKeyRotateResponse struct{}
+
+type FenceNodesRequest struct {
+	VolumeId  string   `json:"volume_id"`
+	NodeCidrs []string `json:"node_cidrs"`
+}
+
+type FenceNodesResponse struct{}
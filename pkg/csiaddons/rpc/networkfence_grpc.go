@@ -0,0 +1,97 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NetworkFenceServer is the server API for the NetworkFence service.
+type NetworkFenceServer interface {
+	FenceNodes(context.Context, *FenceNodesRequest) (*FenceNodesResponse, error)
+	UnfenceNodes(context.Context, *FenceNodesRequest) (*FenceNodesResponse, error)
+}
+
+// UnimplementedNetworkFenceServer must be embedded by every
+// NetworkFenceServer implementation to stay source-compatible with methods
+// added to the interface later.
+type UnimplementedNetworkFenceServer struct{}
+
+func (UnimplementedNetworkFenceServer) FenceNodes(context.Context, *FenceNodesRequest) (*FenceNodesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method FenceNodes not implemented")
+}
+
+func (UnimplementedNetworkFenceServer) UnfenceNodes(context.Context, *FenceNodesRequest) (*FenceNodesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method UnfenceNodes not implemented")
+}
+
+// RegisterNetworkFenceServer registers srv with s so it handles
+// NetworkFence RPCs.
+func RegisterNetworkFenceServer(s *grpc.Server, srv NetworkFenceServer) {
+	s.RegisterService(&networkFenceServiceDesc, srv)
+}
+
+func networkFenceFenceNodesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FenceNodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetworkFenceServer).FenceNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/csiaddons.rancher.longhorn.v1.NetworkFence/FenceNodes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetworkFenceServer).FenceNodes(ctx, req.(*FenceNodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func networkFenceUnfenceNodesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FenceNodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetworkFenceServer).UnfenceNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/csiaddons.rancher.longhorn.v1.NetworkFence/UnfenceNodes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetworkFenceServer).UnfenceNodes(ctx, req.(*FenceNodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var networkFenceServiceDesc = grpc.ServiceDesc{
+	ServiceName: "csiaddons.rancher.longhorn.v1.NetworkFence",
+	HandlerType: (*NetworkFenceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "FenceNodes", Handler: networkFenceFenceNodesHandler},
+		{MethodName: "UnfenceNodes", Handler: networkFenceUnfenceNodesHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "csiaddons.proto",
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReclaimSpaceServer is the server API for the ReclaimSpace service.
+type ReclaimSpaceServer interface {
+	ReclaimSpace(context.Context, *ReclaimSpaceRequest) (*ReclaimSpaceResponse, error)
+}
+
+// UnimplementedReclaimSpaceServer must be embedded by every
+// ReclaimSpaceServer implementation to stay source-compatible with methods
+// added to the interface later.
+type UnimplementedReclaimSpaceServer struct{}
+
+func (UnimplementedReclaimSpaceServer) ReclaimSpace(context.Context, *ReclaimSpaceRequest) (*ReclaimSpaceResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReclaimSpace not implemented")
+}
+
+// RegisterReclaimSpaceServer registers srv with s so it handles
+// ReclaimSpace RPCs.
+func RegisterReclaimSpaceServer(s *grpc.Server, srv ReclaimSpaceServer) {
+	s.RegisterService(&reclaimSpaceServiceDesc, srv)
+}
+
+func reclaimSpaceHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReclaimSpaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReclaimSpaceServer).ReclaimSpace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/csiaddons.rancher.longhorn.v1.ReclaimSpace/ReclaimSpace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReclaimSpaceServer).ReclaimSpace(ctx, req.(*ReclaimSpaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var reclaimSpaceServiceDesc = grpc.ServiceDesc{
+	ServiceName: "csiaddons.rancher.longhorn.v1.ReclaimSpace",
+	HandlerType: (*ReclaimSpaceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ReclaimSpace", Handler: reclaimSpaceHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "csiaddons.proto",
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SnapshotServer is the server API for the Snapshot service.
+type SnapshotServer interface {
+	Snapshot(context.Context, *SnapshotRequest) (*SnapshotResponse, error)
+}
+
+// UnimplementedSnapshotServer must be embedded by every SnapshotServer
+// implementation to stay source-compatible with methods added to the
+// interface later.
+type UnimplementedSnapshotServer struct{}
+
+func (UnimplementedSnapshotServer) Snapshot(context.Context, *SnapshotRequest) (*SnapshotResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Snapshot not implemented")
+}
+
+// RegisterSnapshotServer registers srv with s so it handles Snapshot RPCs.
+func RegisterSnapshotServer(s *grpc.Server, srv SnapshotServer) {
+	s.RegisterService(&snapshotServiceDesc, srv)
+}
+
+func snapshotHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SnapshotServer).Snapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/csiaddons.rancher.longhorn.v1.Snapshot/Snapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SnapshotServer).Snapshot(ctx, req.(*SnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var snapshotServiceDesc = grpc.ServiceDesc{
+	ServiceName: "csiaddons.rancher.longhorn.v1.Snapshot",
+	HandlerType: (*SnapshotServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Snapshot", Handler: snapshotHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "csiaddons.proto",
+}
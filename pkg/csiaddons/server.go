@@ -0,0 +1,156 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package csiaddons implements a CSI-Addons style sidecar gRPC service.
+// The volume actions under api.NewRouter (snapshotBackup, snapshotPurge,
+// snapshotRevert, the backup actions, rotateEncryptionKey) are
+// Longhorn-specific and don't fit the vanilla CSI spec, so an external
+// controller that only speaks CSI cannot invoke them. This package exposes
+// snapshot creation, backup creation and key rotation, plus ReclaimSpace
+// and NetworkFence, as first-class RPCs on a dedicated Unix socket next
+// to the CSI socket, following the pattern other CSI drivers use for
+// csi-addons/spec sidecars. snapshotPurge, snapshotRevert and the backup
+// list/get/delete actions have no RPC here.
+package csiaddons
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/rancher/longhorn-manager/manager"
+	"github.com/rancher/longhorn-manager/pkg/csiaddons/rpc"
+	"github.com/rancher/longhorn-manager/pkg/logutil"
+)
+
+// auditedMethods are the gRPC methods audited by auditInterceptor, keyed by
+// the unqualified method name from grpc.UnaryServerInfo.FullMethod. These
+// are audited the same way api/router.go audits its state-changing HTTP
+// actions, since this package is a second, external-facing entry point to
+// Longhorn volume operations.
+var auditedMethods = map[string]bool{
+	"Snapshot":            true,
+	"Backup":              true,
+	"EncryptionKeyRotate": true,
+	"FenceNodes":          true,
+	"UnfenceNodes":        true,
+}
+
+// Server is the CSI-Addons sidecar. It is started alongside, but
+// independently of, the main CSI gRPC server.
+type Server struct {
+	man       *manager.VolumeManager
+	auditSink logutil.AuditSink
+	grpc      *grpc.Server
+}
+
+// NewServer wires every RPC handler in this package to man, the same
+// VolumeManager the main api.Server uses to implement the HTTP volume
+// actions. Every state-changing call is recorded to auditSink the same way
+// api.NewRouter audits its equivalent HTTP actions.
+func NewServer(man *manager.VolumeManager, auditSink logutil.AuditSink) *Server {
+	s := &Server{
+		man:       man,
+		auditSink: auditSink,
+	}
+	s.grpc = grpc.NewServer(grpc.UnaryInterceptor(s.auditInterceptor), rpc.ServerCodec())
+
+	rpc.RegisterIdentityServer(s.grpc, &identityServer{})
+	rpc.RegisterReclaimSpaceServer(s.grpc, &reclaimSpaceServer{})
+	rpc.RegisterSnapshotServer(s.grpc, &snapshotServer{man: man})
+	rpc.RegisterBackupServer(s.grpc, &backupServer{man: man})
+	rpc.RegisterEncryptionKeyRotateServer(s.grpc, &encryptionKeyRotateServer{man: man})
+	rpc.RegisterNetworkFenceServer(s.grpc, &networkFenceServer{man: man})
+
+	return s
+}
+
+// Run listens on socketPath, a Unix domain socket distinct from the CSI
+// driver's own endpoint, and serves until the process exits. socketPath is
+// removed first if a stale file is left over from a previous run.
+func (s *Server) Run(socketPath string) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("csiaddons: failed to remove stale socket %s: %v", socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("csiaddons: failed to listen on %s: %v", socketPath, err)
+	}
+
+	logrus.Infof("csiaddons: serving on %s", socketPath)
+	return s.grpc.Serve(listener)
+}
+
+// Stop gracefully shuts down the gRPC server.
+func (s *Server) Stop() {
+	s.grpc.GracefulStop()
+}
+
+// auditInterceptor emits an AuditEvent for every call to a method in
+// auditedMethods, after invoking the real handler and recording its result, so these RPCs
+// leave the same trail as their HTTP equivalents in api/router.go.
+func (s *Server) auditInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := methodName(info.FullMethod)
+	if !auditedMethods[method] || s.auditSink == nil {
+		return handler(ctx, req)
+	}
+
+	resp, err := handler(ctx, req)
+
+	result := "success"
+	errMsg := ""
+	if err != nil {
+		result = "failure"
+		errMsg = logutil.SanitizeString(err.Error())
+	}
+
+	s.auditSink.Emit(logutil.NewAuditEvent(volumeIDOf(req), method, "csiaddons", result, errMsg))
+
+	return resp, err
+}
+
+// methodName returns the unqualified RPC name from a gRPC FullMethod such
+// as "/csiaddons.rancher.longhorn.v1.Snapshot/Snapshot".
+func methodName(fullMethod string) string {
+	parts := strings.Split(fullMethod, "/")
+	return parts[len(parts)-1]
+}
+
+// volumeIDOf reads the VolumeId field the volume-scoped request messages in
+// csiaddons.proto carry, via reflection, so auditInterceptor does not need
+// a type switch over every request type. It returns "" for a request with
+// no VolumeId field, such as GetCapabilitiesRequest.
+func volumeIDOf(req interface{}) string {
+	v := reflect.ValueOf(req)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return ""
+	}
+	field := v.FieldByName("VolumeId")
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kms provides a pluggable interface for wrapping and unwrapping the
+// data encryption keys (DEKs) used by the encryption-at-rest feature in the
+// csi package. Implementations are responsible only for protecting the DEK
+// at rest; the DEK itself is generated and used by the caller.
+package kms
+
+import "fmt"
+
+// Provider wraps and unwraps per-volume data encryption keys and supports
+// rotating the key-encryption-key (KEK) used to protect them. Implementations
+// must be safe for concurrent use.
+type Provider interface {
+	// GetKey returns the unwrapped DEK for volName from wrappedDEK, the
+	// ciphertext previously returned by PutKey and persisted on the volume CR.
+	GetKey(volName string, wrappedDEK []byte) ([]byte, error)
+
+	// PutKey wraps dek and returns the ciphertext to be stored on the volume
+	// CR; the provider itself does not store it.
+	PutKey(volName string, dek []byte) (wrappedDEK []byte, err error)
+
+	// RotateKey re-wraps the DEK identified by wrappedDEK under the
+	// provider's current KEK (e.g. after a KEK rotation) without changing
+	// the underlying DEK, returning the new ciphertext.
+	RotateKey(volName string, wrappedDEK []byte) (newWrappedDEK []byte, err error)
+}
+
+// Config selects and configures a Provider for a storage class. It mirrors
+// the `kmsProvider`/`kmsConfigRef` storage class parameters.
+type Config struct {
+	Provider  string
+	ConfigRef string
+}
+
+// ErrKeyNotFound is a sentinel error for a volume with no key. Neither the
+// secret nor the vault provider returns it; their GetKey reports a failed
+// unwrap with its own error.
+var ErrKeyNotFound = fmt.Errorf("kms: key not found")
+
+const (
+	// ProviderKubernetesSecret wraps DEKs with a KEK kept in a Kubernetes
+	// Secret.
+	ProviderKubernetesSecret = "secret"
+	// ProviderVault wraps DEKs using HashiCorp Vault's transit secrets
+	// engine.
+	ProviderVault = "vault"
+)
+
+// New returns the Provider registered for cfg.Provider.
+func New(cfg Config) (Provider, error) {
+	switch cfg.Provider {
+	case ProviderKubernetesSecret:
+		return NewSecretProvider(cfg.ConfigRef)
+	case ProviderVault:
+		return NewVaultProvider(cfg.ConfigRef)
+	default:
+		return nil, fmt.Errorf("kms: unknown provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// secretProvider wraps DEKs with AES-GCM using a KEK stored in a single
+// Kubernetes Secret named by configRef (namespace/name). This is the
+// lowest-dependency provider and the one used when no external KMS is
+// available.
+type secretProvider struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewSecretProvider returns a Provider backed by the Kubernetes Secret
+// identified by configRef, which must be of the form "namespace/name".
+func NewSecretProvider(configRef string) (Provider, error) {
+	namespace, name, err := splitConfigRef(configRef)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", "")
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to build in-cluster config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to create kubernetes client: %v", err)
+	}
+
+	return &secretProvider{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}, nil
+}
+
+func (p *secretProvider) kek() ([]byte, error) {
+	secret, err := p.client.CoreV1().Secrets(p.namespace).Get(p.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to get KEK secret %s/%s: %v", p.namespace, p.name, err)
+	}
+	kek, ok := secret.Data["kek"]
+	if !ok {
+		return nil, fmt.Errorf("kms: secret %s/%s has no \"kek\" key", p.namespace, p.name)
+	}
+	return kek, nil
+}
+
+func (p *secretProvider) GetKey(volName string, wrappedDEK []byte) ([]byte, error) {
+	kek, err := p.kek()
+	if err != nil {
+		return nil, err
+	}
+	return aesGCMOpen(kek, wrappedDEK)
+}
+
+func (p *secretProvider) PutKey(volName string, dek []byte) ([]byte, error) {
+	kek, err := p.kek()
+	if err != nil {
+		return nil, err
+	}
+	return aesGCMSeal(kek, dek)
+}
+
+func (p *secretProvider) RotateKey(volName string, wrappedDEK []byte) ([]byte, error) {
+	dek, err := p.GetKey(volName, wrappedDEK)
+	if err != nil {
+		return nil, err
+	}
+	return p.PutKey(volName, dek)
+}
+
+func splitConfigRef(configRef string) (string, string, error) {
+	for i := len(configRef) - 1; i >= 0; i-- {
+		if configRef[i] == '/' {
+			return configRef[:i], configRef[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("kms: kmsConfigRef %q must be of the form namespace/name", configRef)
+}
+
+func aesGCMSeal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func aesGCMOpen(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("kms: ciphertext too short")
+	}
+	nonce, ct := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, nil)
+}
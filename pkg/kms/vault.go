@@ -0,0 +1,196 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kms
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// vaultProvider wraps DEKs using HashiCorp Vault's transit secrets engine.
+// Authentication is either a static token (the config's "token" field) or
+// the Kubernetes auth method, selected by which fields are present in the
+// referenced config.
+type vaultProvider struct {
+	client  *vaultapi.Client
+	transit string // transit mount path, e.g. "transit"
+	keyName string // name of the transit key used as the KEK
+}
+
+// vaultConfig is the JSON stored in the ConfigMap named by kmsConfigRef for
+// the vault provider.
+type vaultConfig struct {
+	Address       string `json:"address"`
+	TransitMount  string `json:"transitMount"`
+	KeyName       string `json:"keyName"`
+	Token         string `json:"token,omitempty"`
+	Role          string `json:"role,omitempty"`
+	AuthMountPath string `json:"authMountPath,omitempty"`
+	SATokenPath   string `json:"serviceAccountTokenPath,omitempty"`
+}
+
+// NewVaultProvider returns a Provider backed by Vault's transit engine,
+// configured from the vaultConfig referenced by configRef.
+func NewVaultProvider(configRef string) (Provider, error) {
+	cfg, err := loadVaultConfig(configRef)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCfg := vaultapi.DefaultConfig()
+	clientCfg.Address = cfg.Address
+	client, err := vaultapi.NewClient(clientCfg)
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to create vault client: %v", err)
+	}
+
+	if err := authenticate(client, cfg); err != nil {
+		return nil, err
+	}
+
+	transit := cfg.TransitMount
+	if transit == "" {
+		transit = "transit"
+	}
+
+	return &vaultProvider{
+		client:  client,
+		transit: transit,
+		keyName: cfg.KeyName,
+	}, nil
+}
+
+// authenticate logs in to Vault using a static token if one is supplied,
+// otherwise falls back to the Kubernetes auth method using the node's
+// projected service account token.
+func authenticate(client *vaultapi.Client, cfg *vaultConfig) error {
+	if cfg.Token != "" {
+		client.SetToken(cfg.Token)
+		return nil
+	}
+
+	saTokenPath := cfg.SATokenPath
+	if saTokenPath == "" {
+		saTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+	jwt, err := ioutil.ReadFile(saTokenPath)
+	if err != nil {
+		return fmt.Errorf("kms: failed to read service account token: %v", err)
+	}
+
+	authMountPath := cfg.AuthMountPath
+	if authMountPath == "" {
+		authMountPath = "kubernetes"
+	}
+
+	secret, err := client.Logical().Write(fmt.Sprintf("auth/%s/login", authMountPath), map[string]interface{}{
+		"role": cfg.Role,
+		"jwt":  string(jwt),
+	})
+	if err != nil || secret == nil || secret.Auth == nil {
+		return fmt.Errorf("kms: vault kubernetes auth login failed: %v", err)
+	}
+
+	client.SetToken(secret.Auth.ClientToken)
+	return nil
+}
+
+func (p *vaultProvider) GetKey(volName string, wrappedDEK []byte) ([]byte, error) {
+	path := fmt.Sprintf("%s/decrypt/%s", p.transit, p.keyName)
+	secret, err := p.client.Logical().Write(path, map[string]interface{}{
+		"ciphertext": string(wrappedDEK),
+	})
+	if err != nil || secret == nil {
+		return nil, fmt.Errorf("kms: vault decrypt for volume %s failed: %v", volName, err)
+	}
+	plaintext, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("kms: vault decrypt response missing plaintext")
+	}
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+func (p *vaultProvider) PutKey(volName string, dek []byte) ([]byte, error) {
+	path := fmt.Sprintf("%s/encrypt/%s", p.transit, p.keyName)
+	secret, err := p.client.Logical().Write(path, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(dek),
+	})
+	if err != nil || secret == nil {
+		return nil, fmt.Errorf("kms: vault encrypt for volume %s failed: %v", volName, err)
+	}
+	ciphertext, ok := secret.Data["ciphertext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("kms: vault encrypt response missing ciphertext")
+	}
+	return []byte(ciphertext), nil
+}
+
+func (p *vaultProvider) RotateKey(volName string, wrappedDEK []byte) ([]byte, error) {
+	path := fmt.Sprintf("%s/rewrap/%s", p.transit, p.keyName)
+	secret, err := p.client.Logical().Write(path, map[string]interface{}{
+		"ciphertext": string(wrappedDEK),
+	})
+	if err != nil || secret == nil {
+		return nil, fmt.Errorf("kms: vault rewrap for volume %s failed: %v", volName, err)
+	}
+	ciphertext, ok := secret.Data["ciphertext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("kms: vault rewrap response missing ciphertext")
+	}
+	return []byte(ciphertext), nil
+}
+
+// loadVaultConfig reads the vaultConfig JSON stored under the "config" key
+// of the ConfigMap identified by configRef, which must be of the form
+// "namespace/name".
+func loadVaultConfig(configRef string) (*vaultConfig, error) {
+	namespace, name, err := splitConfigRef(configRef)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeCfg, err := clientcmd.BuildConfigFromFlags("", "")
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to build in-cluster config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(kubeCfg)
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to create kubernetes client: %v", err)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to get vault config %s/%s: %v", namespace, name, err)
+	}
+	raw, ok := cm.Data["config"]
+	if !ok {
+		return nil, fmt.Errorf("kms: configmap %s/%s has no \"config\" key", namespace, name)
+	}
+
+	cfg := &vaultConfig{}
+	if err := json.Unmarshal([]byte(raw), cfg); err != nil {
+		return nil, fmt.Errorf("kms: failed to parse vault config %s/%s: %v", namespace, name, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// AuditEvent records a single state-changing call into the Longhorn API,
+// independent of whether it succeeded.
+type AuditEvent struct {
+	Timestamp string `json:"timestamp"`
+	Volume    string `json:"volume"`
+	Action    string `json:"action"`
+	Caller    string `json:"caller"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewAuditEvent returns an AuditEvent with Timestamp stamped to now, so
+// every caller constructing one gets a consistent, correctly formatted
+// value instead of having to remember to set it.
+func NewAuditEvent(volume, action, caller, result, errMsg string) AuditEvent {
+	return AuditEvent{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Volume:    volume,
+		Action:    action,
+		Caller:    caller,
+		Result:    result,
+		Error:     errMsg,
+	}
+}
+
+// AuditSink receives AuditEvents as they happen. Implementations must be
+// safe for concurrent use, since the router may handle requests for
+// different volumes in parallel.
+type AuditSink interface {
+	Emit(event AuditEvent)
+}
+
+// NewStdoutAuditSink returns a sink that writes each event as a single line
+// of JSON to stdout, for deployments that collect container logs centrally.
+func NewStdoutAuditSink() AuditSink {
+	return &writerAuditSink{}
+}
+
+// NewFileAuditSink returns a sink that appends each event as a single line
+// of JSON to the file at path, creating it if necessary.
+func NewFileAuditSink(path string) (AuditSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("logutil: failed to open audit log %s: %v", path, err)
+	}
+	return &writerAuditSink{file: f}, nil
+}
+
+type writerAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (s *writerAuditSink) Emit(event AuditEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		fmt.Fprintln(s.file, string(data))
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// NewKubernetesEventAuditSink returns a sink that records each event as a
+// Kubernetes Event against the named volume, using recorder (typically
+// built from an EventBroadcaster against client).
+func NewKubernetesEventAuditSink(client kubernetes.Interface, recorder record.EventRecorder) AuditSink {
+	return &kubeEventAuditSink{client: client, recorder: recorder}
+}
+
+type kubeEventAuditSink struct {
+	client   kubernetes.Interface
+	recorder record.EventRecorder
+}
+
+func (s *kubeEventAuditSink) Emit(event AuditEvent) {
+	ref := &v1.ObjectReference{
+		Kind:      "Volume",
+		Name:      event.Volume,
+		Namespace: "longhorn-system",
+	}
+
+	reason := event.Action
+	message := fmt.Sprintf("caller=%s result=%s", event.Caller, event.Result)
+	if event.Error != "" {
+		message = fmt.Sprintf("%s error=%s", message, event.Error)
+	}
+
+	if event.Result == "success" {
+		s.recorder.Event(ref, v1.EventTypeNormal, reason, message)
+	} else {
+		s.recorder.Event(ref, v1.EventTypeWarning, reason, message)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logutil provides helpers for keeping credentials out of logs.
+// Sanitize is modeled on
+// github.com/kubernetes-csi/csi-lib-utils/protosanitizer.StripSecrets, but
+// also understands the map-shaped fields (Secrets, VolumeContext) that carry
+// CHAP and service-account credentials in this driver's CSI requests.
+package logutil
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const redacted = "***stripped***"
+
+// sensitiveName matches struct field names and map keys that are known to
+// carry credentials: CHAP secrets on NodePublishVolumeRequest, the raw
+// iscsiadm key names those secrets are keyed by, and service account
+// tokens used for Vault auth. The latter is deliberately not a full-string
+// anchor: a bound service account token arrives in VolumeContext under the
+// key "csi.storage.k8s.io/serviceAccount.tokens" (the standard
+// CSIServiceAccountToken field), so it is matched as a substring rather
+// than an exact field name.
+var sensitiveName = regexp.MustCompile(`(?i)^(secret|password|token)$|^node\.(session|sendtargets)\.auth\.password.*$|serviceaccount.*token`)
+
+// Sanitize returns a string representation of msg with every field or map
+// entry whose name matches sensitiveName replaced by a fixed placeholder.
+// It never panics on msg; a nil or malformed message simply stringifies as
+// such.
+func Sanitize(msg proto.Message) string {
+	if msg == nil || reflect.ValueOf(msg).IsNil() {
+		return "<nil>"
+	}
+	return sanitizeValue(reflect.ValueOf(msg), "")
+}
+
+func sanitizeValue(v reflect.Value, name string) string {
+	if !v.IsValid() {
+		return "<nil>"
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "<nil>"
+		}
+		return sanitizeValue(v.Elem(), name)
+	case reflect.Struct:
+		return sanitizeStruct(v)
+	case reflect.Map:
+		return sanitizeMap(v)
+	case reflect.Slice, reflect.Array:
+		return sanitizeSlice(v, name)
+	case reflect.String:
+		if sensitiveName.MatchString(name) {
+			return fmt.Sprintf("%q", redacted)
+		}
+		return fmt.Sprintf("%q", v.String())
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
+
+func sanitizeStruct(v reflect.Value) string {
+	t := v.Type()
+	var b strings.Builder
+	b.WriteString(t.Name())
+	b.WriteByte('{')
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported, e.g. protobuf internal bookkeeping fields.
+			continue
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(field.Name)
+		b.WriteByte(':')
+		if sensitiveName.MatchString(field.Name) {
+			b.WriteString(fmt.Sprintf("%q", redacted))
+			continue
+		}
+		b.WriteString(sanitizeValue(v.Field(i), field.Name))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func sanitizeMap(v reflect.Value) string {
+	keys := v.MapKeys()
+	keyStrs := make([]string, len(keys))
+	for i, k := range keys {
+		keyStrs[i] = fmt.Sprintf("%v", k.Interface())
+	}
+	sort.Strings(keyStrs)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, ks := range keyStrs {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(fmt.Sprintf("%q:", ks))
+		if sensitiveName.MatchString(ks) {
+			b.WriteString(fmt.Sprintf("%q", redacted))
+			continue
+		}
+		entry := v.MapIndex(reflect.ValueOf(ks).Convert(v.Type().Key()))
+		b.WriteString(sanitizeValue(entry, ks))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func sanitizeSlice(v reflect.Value, name string) string {
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		// []byte, e.g. a wrapped DEK: never worth logging either way.
+		return fmt.Sprintf("%q", redacted)
+	}
+
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(sanitizeValue(v.Index(i), name))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// kvPattern matches a "secret=", "password=" or "token=" pair, in any case,
+// up to the next whitespace.
+var kvPattern = regexp.MustCompile(`(?i)\b(secret|password|token)=\S+`)
+
+// SanitizeString redacts the value of every kvPattern match in a plain
+// error or log message, for call sites (like HandleError) that do not have
+// a proto.Message to work with but may be formatting an error that embeds
+// a "key=value"-shaped credential. It matches fewer names than Sanitize:
+// keys such as "password_in" or "serviceAccountToken" are left as they are.
+func SanitizeString(s string) string {
+	return kvPattern.ReplaceAllString(s, "$1="+redacted)
+}
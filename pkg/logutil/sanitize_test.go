@@ -0,0 +1,124 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestSanitizeRedactsSensitiveFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *csi.NodePublishVolumeRequest
+		wantGone []string
+		wantKept []string
+	}{
+		{
+			name: "chap secret in Secrets map",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId: "vol-1",
+				Secrets:  map[string]string{"node.session.auth.password": "hunter2"},
+			},
+			wantGone: []string{"hunter2"},
+			wantKept: []string{"vol-1", "node.session.auth.password"},
+		},
+		{
+			name: "service account token in VolumeContext",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:      "vol-2",
+				VolumeContext: map[string]string{"serviceAccountToken": "eyJhbGciOiJSUzI1NiJ9"},
+			},
+			wantGone: []string{"eyJhbGciOiJSUzI1NiJ9"},
+			wantKept: []string{"vol-2"},
+		},
+		{
+			name: "bound service account token under its real CSIServiceAccountToken key",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:      "vol-4",
+				VolumeContext: map[string]string{"csi.storage.k8s.io/serviceAccount.tokens": "eyJhbGciOiJSUzI1NiJ9"},
+			},
+			wantGone: []string{"eyJhbGciOiJSUzI1NiJ9"},
+			wantKept: []string{"vol-4"},
+		},
+		{
+			name: "non-sensitive fields are left alone",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   "vol-3",
+				TargetPath: "/var/lib/kubelet/pods/abc/volumes/vol-3",
+			},
+			wantKept: []string{"vol-3", "/var/lib/kubelet/pods/abc/volumes/vol-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sanitize(tt.req)
+			for _, s := range tt.wantGone {
+				if strings.Contains(got, s) {
+					t.Errorf("Sanitize(%+v) = %q, want it to not contain %q", tt.req, got, s)
+				}
+			}
+			for _, s := range tt.wantKept {
+				if !strings.Contains(got, s) {
+					t.Errorf("Sanitize(%+v) = %q, want it to contain %q", tt.req, got, s)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeNilMessage(t *testing.T) {
+	var req *csi.NodePublishVolumeRequest
+	if got := Sanitize(req); got != "<nil>" {
+		t.Errorf("Sanitize(nil) = %q, want %q", got, "<nil>")
+	}
+}
+
+func TestSanitizeStringRedactsKeyValuePairs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "password in error message",
+			in:   `auth failed: password=hunter2 for user bob`,
+			want: `auth failed: password=***stripped*** for user bob`,
+		},
+		{
+			name: "token case-insensitive",
+			in:   `TOKEN=abc123 rejected`,
+			want: `TOKEN=***stripped*** rejected`,
+		},
+		{
+			name: "no match is unchanged",
+			in:   `volume vol-1 not found`,
+			want: `volume vol-1 not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeString(tt.in); got != tt.want {
+				t.Errorf("SanitizeString(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}